@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dsoprea/go-exif"
+)
+
+// cameraInfo is the subset of EXIF fields the -template flag can reference
+// beyond the timestamp: Make, Model and ISOSpeedRatings. It's best-effort —
+// formats whose EXIF we don't (yet) unpack for general tag lookup (PNG,
+// HEIC, MP4/MOV) simply yield zero values.
+type cameraInfo struct {
+	Make  string
+	Model string
+	ISO   int
+}
+
+// exifRawBytesForTags returns the raw TIFF/EXIF byte stream backing path,
+// for the formats whose EXIF IFDs we can walk generically (JPEG's APP1
+// segment, or a bare TIFF-based stream for TIFF/DNG/CR2/NEF/ARW).
+func exifRawBytesForTags(path string) ([]byte, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		return exif.SearchFileAndExtractExif(path)
+	case ".tiff", ".tif", ".dng", ".cr2", ".nef", ".arw":
+		return os.ReadFile(path)
+	default:
+		return nil, errNoMediaTimestamp
+	}
+}
+
+// exifIndexFromRawBytes builds an IFD index from a raw TIFF/EXIF byte
+// stream, for generic tag lookups.
+func exifIndexFromRawBytes(rawExif []byte) (index exif.IfdIndex, err error) {
+	im := exif.NewIfdMapping()
+	if err = exif.LoadStandardIfds(im); err != nil {
+		return
+	}
+
+	ti := exif.NewTagIndex()
+	_, index, err = exif.Collect(im, ti, rawExif)
+	return
+}
+
+// exifTagString looks up tagName in ifdPath ("" for the root IFD0) and
+// stringifies whatever value it finds.
+func exifTagString(index exif.IfdIndex, ifdPath, tagName string) (string, bool) {
+	ifd := index.RootIfd
+	if ifdPath != "" {
+		child, err := index.RootIfd.ChildWithIfdPath(ifdPath)
+		if err != nil {
+			return "", false
+		}
+		ifd = child
+	}
+
+	results, err := ifd.FindTagWithName(tagName)
+	if err != nil || len(results) == 0 {
+		return "", false
+	}
+
+	value, err := index.RootIfd.TagValue(results[0])
+	if err != nil {
+		return "", false
+	}
+
+	switch v := value.(type) {
+	case string:
+		return strings.TrimRight(v, "\x00"), true
+	case []uint16:
+		if len(v) > 0 {
+			return strconv.Itoa(int(v[0])), true
+		}
+	}
+	return "", false
+}
+
+// readCameraInfo extracts Make/Model/ISOSpeedRatings from path's EXIF, if
+// any is readable. Errors are swallowed: a missing Make/Model/ISO just
+// leaves those template fields empty.
+func readCameraInfo(path string) cameraInfo {
+	var info cameraInfo
+
+	rawExif, err := exifRawBytesForTags(path)
+	if err != nil {
+		return info
+	}
+
+	index, err := exifIndexFromRawBytes(rawExif)
+	if err != nil {
+		return info
+	}
+
+	if v, ok := exifTagString(index, "", "Make"); ok {
+		info.Make = v
+	}
+	if v, ok := exifTagString(index, "", "Model"); ok {
+		info.Model = v
+	}
+	if v, ok := exifTagString(index, "IFD/Exif", "ISOSpeedRatings"); ok {
+		if iso, err := strconv.Atoi(v); err == nil {
+			info.ISO = iso
+		}
+	}
+
+	return info
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// copyBufferSize is the io.CopyBuffer chunk size, well above the default
+// 4096-byte stat block size so large JPEGs/RAWs/videos copy in fewer,
+// larger syscalls.
+const copyBufferSize = 1 << 20 // 1 MiB
+
+// copyPreserving copies srcPath to destPath (which must not already exist,
+// permissioned as perm) and then carries over everything a plain io.Copy
+// drops: the source's mtime/atime, its owner/group when running as root,
+// and, on platforms that support it, extended attributes.
+//
+// Ownership and xattr preservation are best-effort: a non-root copy can't
+// chown, and not every filesystem/platform supports xattrs, so failures
+// there are reported to the caller via the returned warnings rather than
+// failing the copy outright.
+func copyPreserving(srcPath, destPath string, srcInfo os.FileInfo, perm os.FileMode) (warnings []error, err error) {
+	fin, err := os.Open(srcPath)
+	if err != nil {
+		return nil, err
+	}
+	defer fin.Close()
+
+	fout, err := os.OpenFile(destPath, os.O_CREATE|os.O_WRONLY|os.O_EXCL, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, copyBufferSize)
+	_, copyErr := io.CopyBuffer(fout, fin, buf)
+	closeErr := fout.Close()
+	if copyErr != nil {
+		return nil, copyErr
+	}
+	if closeErr != nil {
+		return nil, closeErr
+	}
+
+	if err := preserveTimes(destPath, srcInfo); err != nil {
+		return warnings, fmt.Errorf("preserving times on \"%s\": %w", destPath, err)
+	}
+
+	if err := preserveOwnership(destPath, srcInfo); err != nil {
+		warnings = append(warnings, fmt.Errorf("preserving ownership on \"%s\": %w", destPath, err))
+	}
+	if err := copyXattrs(srcPath, destPath); err != nil {
+		warnings = append(warnings, fmt.Errorf("preserving xattrs on \"%s\": %w", destPath, err))
+	}
+
+	return warnings, nil
+}
+
+// preserveTimes sets destPath's atime/mtime to match info, the access time
+// coming from the platform-specific stat extension where available.
+func preserveTimes(path string, info os.FileInfo) error {
+	return os.Chtimes(path, statAtime(info), info.ModTime())
+}
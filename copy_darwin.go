@@ -0,0 +1,20 @@
+//go:build darwin
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// statAtime extracts the access time from info's Darwin-specific Stat_t,
+// falling back to its mtime if the underlying os.FileInfo wasn't built
+// from a syscall.Stat_t.
+func statAtime(info os.FileInfo) time.Time {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime()
+	}
+	return time.Unix(stat.Atimespec.Sec, stat.Atimespec.Nsec)
+}
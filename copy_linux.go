@@ -0,0 +1,20 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// statAtime extracts the access time from info's Linux-specific Stat_t,
+// falling back to its mtime if the underlying os.FileInfo wasn't built
+// from a syscall.Stat_t (e.g. a fake FileInfo in a future test).
+func statAtime(info os.FileInfo) time.Time {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime()
+	}
+	return time.Unix(stat.Atim.Sec, stat.Atim.Nsec)
+}
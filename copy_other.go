@@ -0,0 +1,25 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// statAtime has no portable access-time source outside Linux/Darwin, so it
+// falls back to mtime.
+func statAtime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
+
+// preserveOwnership is a no-op on platforms without POSIX chown semantics.
+func preserveOwnership(path string, info os.FileInfo) error {
+	return nil
+}
+
+// copyXattrs is a no-op on platforms without the xattr syscalls this tool
+// knows how to drive.
+func copyXattrs(src, dst string) error {
+	return nil
+}
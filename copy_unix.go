@@ -0,0 +1,77 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// preserveOwnership chowns path to match info's owner/group when running
+// as root. For a non-root process it does nothing and returns nil, so no
+// ownership warning is reported there.
+func preserveOwnership(path string, info os.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if os.Geteuid() != 0 {
+		return nil
+	}
+	return os.Chown(path, int(stat.Uid), int(stat.Gid))
+}
+
+// copyXattrs copies every extended attribute from src to dst.
+func copyXattrs(src, dst string) error {
+	size, err := unix.Listxattr(src, nil)
+	if err != nil {
+		if err == unix.ENOTSUP {
+			return nil
+		}
+		return err
+	}
+	if size == 0 {
+		return nil
+	}
+
+	list := make([]byte, size)
+	n, err := unix.Listxattr(src, list)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range splitXattrNames(list[:n]) {
+		valSize, err := unix.Getxattr(src, name, nil)
+		if err != nil {
+			return err
+		}
+		val := make([]byte, valSize)
+		if valSize > 0 {
+			if _, err := unix.Getxattr(src, name, val); err != nil {
+				return err
+			}
+		}
+		if err := unix.Setxattr(dst, name, val, 0); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// splitXattrNames splits the NUL-separated name list Listxattr fills in.
+func splitXattrNames(list []byte) []string {
+	var names []string
+	start := 0
+	for i, b := range list {
+		if b == 0 {
+			if i > start {
+				names = append(names, string(list[start:i]))
+			}
+			start = i + 1
+		}
+	}
+	return names
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ContentSidecar is the JSON record written next to each blob in the
+// content-addressed store.
+type ContentSidecar struct {
+	Hash      string `json:"hash"`
+	Algorithm string `json:"algorithm"`
+	Size      int64  `json:"size"`
+}
+
+// newContentHash returns a fresh hash.Hash for the given -hash flag value
+// ("md5" or "sha256").
+func newContentHash(algo string) (hash.Hash, error) {
+	switch algo {
+	case "md5":
+		return md5.New(), nil
+	case "sha256":
+		return sha256.New(), nil
+	default:
+		return nil, fmt.Errorf("unknown -hash algorithm %q (want md5 or sha256)", algo)
+	}
+}
+
+// hashFile computes the digest of the file at path using the given algorithm.
+func hashFile(path string, algo string) (digest string, size int64, err error) {
+	h, err := newContentHash(algo)
+	if err != nil {
+		return
+	}
+
+	fin, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer fin.Close()
+
+	size, err = io.Copy(h, fin)
+	if err != nil {
+		return
+	}
+
+	digest = hex.EncodeToString(h.Sum(nil))
+	return
+}
+
+// contentStorePath computes the two-level fanout path for a digest under
+// contentRoot, e.g. <contentRoot>/<xx>/<rest-of-hash><ext>.
+func contentStorePath(contentRoot, digest, ext string) string {
+	return filepath.Join(contentRoot, digest[0:2], digest[2:]+ext)
+}
+
+// putContent ensures srcPath's bytes exist in the content-addressed store
+// rooted at contentRoot, writing a JSON sidecar with the digest alongside
+// the blob. If the blob already exists (identical content already stored),
+// the copy is skipped. It returns the path to the stored blob. wip tracks
+// the blob path for the duration of the write, so an interrupt mid-copy
+// doesn't leave an untracked half-written blob in the content store.
+func putContent(srcPath, contentRoot, algo, ext string, perm os.FileMode, wip *WipTracker) (contentPath string, err error) {
+	digest, size, err := hashFile(srcPath, algo)
+	if err != nil {
+		return
+	}
+
+	contentPath = contentStorePath(contentRoot, digest, ext)
+	if PathExists(contentPath) {
+		// Identical content already stored; nothing to copy.
+		return
+	}
+
+	if err = os.MkdirAll(filepath.Dir(contentPath), 0755); err != nil {
+		return
+	}
+
+	wip.Add(contentPath)
+	defer wip.Remove(contentPath)
+
+	if err = copyFileContents(srcPath, contentPath, perm); err != nil {
+		if os.IsExist(err) {
+			// Another worker raced us to store this identical content
+			// (the PathExists check above isn't atomic); the blob is
+			// already there, so proceed as if we'd stored it.
+			err = nil
+			return contentPath, nil
+		}
+		return
+	}
+
+	sidecar := ContentSidecar{Hash: digest, Algorithm: algo, Size: size}
+	sidecarBytes, err := json.MarshalIndent(sidecar, "", "  ")
+	if err != nil {
+		return
+	}
+	err = os.WriteFile(contentPath+".json", sidecarBytes, 0644)
+	return
+}
+
+// copyFileContents copies srcPath to dstPath, failing if dstPath already
+// exists.
+func copyFileContents(srcPath, dstPath string, perm os.FileMode) error {
+	fin, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer fin.Close()
+
+	fout, err := os.OpenFile(dstPath, os.O_CREATE|os.O_WRONLY|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	defer fout.Close()
+
+	_, err = io.Copy(fout, fin)
+	return err
+}
+
+// linkToContent creates the timestamp-named destPath as a link (symlink or
+// hardlink, per doSymlink) pointing at contentPath.
+func linkToContent(destPath, contentPath string, doSymlink bool) error {
+	if doSymlink {
+		relName, err := filepath.Rel(filepath.Dir(destPath), contentPath)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(relName, destPath)
+	}
+	return os.Link(contentPath, destPath)
+}
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -14,23 +13,17 @@ import (
 	"github.com/dsoprea/go-exif"
 )
 
-var (
-	errNoDateTimeOriginal = errors.New("Could not find DateTimeOriginal EXIF tag")
-)
-
+// extractDateTimeOriginal reads DateTimeOriginal/SubSecTimeOriginal out of a
+// JPEG's EXIF APP1 segment. It's the JPEG case of MediaTimestamp's dispatch;
+// every other format parses its EXIF (or format-native timestamp) in
+// mediatimestamp.go.
 func extractDateTimeOriginal(path string) (dateTime time.Time, err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			err = errNoDateTimeOriginal
+			err = errNoMediaTimestamp
 		}
 	}()
 
-	ext := strings.ToLower(filepath.Ext(path))
-	if ext != ".jpg" && ext != ".jpeg" {
-		err = errNoDateTimeOriginal
-		return
-	}
-
 	rawExif, err := exif.SearchFileAndExtractExif(path)
 	if err != nil {
 		return
@@ -50,38 +43,7 @@ func extractDateTimeOriginal(path string) (dateTime time.Time, err error) {
 		return
 	}
 
-	// Read DateTimeOriginal plus SubSecTimeOriginal:
-	exifIfd, err := index.RootIfd.ChildWithIfdPath("IFD/Exif")
-	if err != nil {
-		return
-	}
-
-	results, err := exifIfd.FindTagWithName("DateTimeOriginal")
-	if len(results) == 0 {
-		err = errNoDateTimeOriginal
-		return
-	}
-
-	dateTimeOriginal, err := index.RootIfd.TagValue(results[0])
-	if err != nil {
-		return
-	}
-
-	results, err = exifIfd.FindTagWithName("SubSecTimeOriginal")
-	var subSecTimeOriginal interface{}
-	if len(results) == 1 {
-		subSecTimeOriginal, err = index.RootIfd.TagValue(results[0])
-		if err != nil {
-			return
-		}
-	} else {
-		subSecTimeOriginal = "000"
-	}
-
-	dateTimeFmt := dateTimeOriginal.(string) + "." + subSecTimeOriginal.(string)
-	dateTime, err = time.Parse("2006:01:02 15:04:05.999", dateTimeFmt)
-
-	return
+	return exifDateTimeFromTags(index)
 }
 
 func NoExt(path string) string {
@@ -105,14 +67,37 @@ func PathExists(path string) bool {
 }
 
 type Source struct {
-	File             os.FileInfo
-	IsJpeg           bool
+	File os.FileInfo
+	// IsMedia marks this as a primary media file eligible for
+	// MediaTimestamp-based renaming, as opposed to a related companion
+	// file (sidecar, thumbnail, etc.) that just keeps its own basename.
+	IsMedia          bool
 	Path             string
 	Dir              string
 	Filename         string
 	RelatedFilenames []string
 }
 
+// mediaExtPatterns are the filepath.Match patterns (case-insensitive via
+// character classes) recognized as primary media files.
+var mediaExtPatterns = []string{
+	"*.[jJ][pP][gG]", "*.[jJ][pP][eE][gG]", "*.[pP][nN][gG]",
+	"*.[tT][iI][fF]", "*.[tT][iI][fF][fF]", "*.[dD][nN][gG]",
+	"*.[cC][rR]2", "*.[nN][eE][fF]", "*.[aA][rR][wW]",
+	"*.[hH][eE][iI][cC]", "*.[hH][eE][iI][fF]",
+}
+
+// isMediaFile reports whether filename matches a recognized primary media
+// extension.
+func isMediaFile(filename string) bool {
+	for _, pattern := range mediaExtPatterns {
+		if ok, _ := filepath.Match(pattern, filename); ok {
+			return true
+		}
+	}
+	return false
+}
+
 func main() {
 	doRelated := flag.Bool("related", false, "Include files with same filename yet different extension")
 	useModTime := flag.Bool("modtime", false, "Use mod time if no EXIF tag found")
@@ -125,8 +110,44 @@ func main() {
 	sourceFolder := flag.String("source", "", "Source folder to scan for JPEGs")
 	doRecurse := flag.Bool("recurse", false, "Recurse into subdirectories of source folder")
 	targetFolder := flag.String("target", ".", "Destination folder to copy/move files to")
+	doDedupe := flag.Bool("dedupe", false, "Store file content in a content-addressed '<target>/content' store and link to it from the date-named path")
+	hashAlgo := flag.String("hash", "md5", "Hash algorithm to use for -dedupe content addressing: md5 or sha256")
+	jobs := flag.Int("jobs", 1, "Number of worker goroutines to use for parsing and acting on files in parallel")
+	tmplFlag := flag.String("template", "", "Go text/template string evaluated per file to build its destination path, e.g. '{{.Year}}/{{.Month}}/{{.TimestampBase}}_{{.CameraModel}}{{.Ext}}'")
+	byDate := flag.Bool("bydate", false, "Shortcut for -template '"+bydateTemplate+"'")
+	sidecarFlag := flag.String("sidecar", "none", "Write a metadata sidecar for each renamed file: json, yaml, or none")
+	sidecarHidden := flag.Bool("sidecar-hidden", false, "Write sidecars as dotfiles (.basename.ext.json) instead of basename.ext.json")
+	tagsFlag := flag.String("tags", "", "Comma-separated tags to record in written sidecars")
+	tzFlag := flag.String("tz", "", "Timezone to interpret camera-local timestamps in: an IANA zone name, 'auto' (EXIF offset tag, falling back to GPS), or '' for the historical UTC-naive behavior")
+	dryRun := flag.Bool("dry-run", false, "Print the plan and report conflicts without touching the filesystem")
+	dryRunJSON := flag.Bool("dry-run-json", false, "With -dry-run, print the plan as JSON")
+	undoJournal := flag.String("undo", "", "Reverse every action recorded in the given undo journal file and exit")
 	flag.Parse()
 
+	if *undoJournal != "" {
+		if err := RunUndo(*undoJournal); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(-1)
+		}
+		return
+	}
+
+	if *byDate && *tmplFlag == "" {
+		*tmplFlag = bydateTemplate
+	}
+
+	sidecarFormat, sidecarErr := ParseSidecarFormat(*sidecarFlag)
+	if sidecarErr != nil {
+		fmt.Fprintln(os.Stderr, sidecarErr)
+		os.Exit(-1)
+		return
+	}
+
+	var tags []string
+	if *tagsFlag != "" {
+		tags = strings.Split(*tagsFlag, ",")
+	}
+
 	if *doCopy && *doMove {
 		*doMove = false
 	}
@@ -140,6 +161,14 @@ func main() {
 		return
 	}
 
+	if *doDedupe {
+		if _, err := newContentHash(*hashAlgo); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(-1)
+			return
+		}
+	}
+
 	*sourceFolder = filepath.Clean(*sourceFolder)
 	basePath := *sourceFolder
 
@@ -171,17 +200,14 @@ func main() {
 		}
 
 		// Match filename:
-		isJpg, _ := filepath.Match("*.[jJ][pP][gG]", filename)
-		isJpeg, _ := filepath.Match("*.[jJ][pP][eE][gG]", filename)
-		isPng, _ := filepath.Match("*.[pP][nN][gG]", filename)
-		if isJpg || isJpeg || isPng {
+		if isMediaFile(filename) {
 			// Track this file as a source:
 			sources = append(sources, &Source{
 				File:     info,
 				Path:     path,
 				Dir:      dir,
 				Filename: filename,
-				IsJpeg:   true,
+				IsMedia:  true,
 			})
 		} else {
 			// Append filename to directory map:
@@ -252,176 +278,54 @@ func main() {
 				continue
 			}
 
+			src.IsMedia = true
 			src.RelatedFilenames = []string{src.Filename}
 			sources = append(sources, src)
 		}
 	}
 
-	for _, source := range sources {
-		var dateTime time.Time
-		var timestampFilename string
-		names := source.RelatedFilenames
-
-		if source.IsJpeg {
-			// Find ModTime:
-			path := source.Path
-			dateTime, err := extractDateTimeOriginal(path)
-			if err != nil {
-				if *useModTime && err == errNoDateTimeOriginal {
-					// Use file modification date if no EXIF tag found:
-					dateTime = source.File.ModTime()
-				} else {
-					fmt.Fprintf(os.Stderr, "\"%s\": %v\n", path, err)
-					continue
-				}
-			}
-
-			// Generate timestamp base name:
-			timestampFilename = dateTime.Format("20060102_150405")
-			timestampFilename += fmt.Sprintf("_%03d", int64(time.Duration(dateTime.Nanosecond())/time.Millisecond))
-		}
-
-		// Rename all related files to use timestamp:
-	nextName:
-		for _, name := range names {
-			// srcPath is relative path from *sourceFolder but not including *sourceFolder prefix
-			srcPath := filepath.Join(source.Dir, name)
-
-			var destFilename string
-			destExt := strings.ToLower(filepath.Ext(srcPath))
-
-			if source.IsJpeg {
-				destFilename = timestampFilename
-			} else {
-				destFilename = NoExt(name)
-			}
-
-			// Generate destination path:
-			destPath := filepath.Join(*targetFolder, source.Dir, destFilename+destExt)
-
-			if !*doOverwrite {
-				// Check if destination path exists:
-				destPathExists := PathExists(destPath)
-				if destPathExists {
-					if *useSuffixes {
-						// Generate a unique suffix and retry:
-						for counter := 1; ; counter++ {
-							destFilenameSuffix := fmt.Sprintf("%s_%d%s", destFilename, counter, destExt)
-							destPath = filepath.Join(*targetFolder, source.Dir, destFilenameSuffix)
-							if !PathExists(destPath) {
-								break
-							}
-						}
-					} else {
-						fmt.Fprintf(os.Stderr, "\"%s\": Not overwriting existing file \"%s\"\n", srcPath, destPath)
-						continue nextName
-					}
-				}
-			}
-
-			filePerm := os.FileMode(0644)
-			if *doCopy || *doMove || *doSymlink || *doHardlink {
-				stat := source.File
-
-				// Take file permissions of original file:
-				filePerm = stat.Mode() & os.ModePerm
-
-				// Compute directory permissions by setting 'x' bit for each corresponding 'r' bit:
-				// e.g. 'r--r--r--' => 'r-xr-xr-x'
-				dirPerm := filePerm | ((filePerm & 0444) >> 2)
-
-				// Make directory for target file to be contained in:
-				err = os.MkdirAll(filepath.Dir(destPath), dirPerm)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "\"%s\": %v\n", srcPath, err)
-					continue nextName
-				}
-
-				// Remove target file if overwriting is enabled:
-				if *doOverwrite {
-					os.Remove(destPath)
-				}
-			}
-
-			// Figure out what to do with the file:
-			if *doCopy {
-				fmt.Printf("cp \"%s\" \"%s\"\n", srcPath, destPath)
-
-				// Open source file for reading:
-				fin, err := os.Open(srcPath)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "\"%s\": %v\n", srcPath, err)
-					continue nextName
-				}
-
-				// Open target file for writing:
-				fout, err := os.OpenFile(destPath, os.O_CREATE|os.O_WRONLY|os.O_EXCL, filePerm)
-				if err != nil {
-					fin.Close()
-					fmt.Fprintf(os.Stderr, "\"%s\": %v\n", srcPath, err)
-					continue nextName
-				}
-
-				// Copy file contents from source to target in 4096 byte chunks:
-				buf := make([]byte, 4096)
-				n := 4096
-				for n > 0 {
-					// Read from source:
-					n, err = fin.Read(buf)
-					if err == io.EOF {
-						break
-					}
-					if err != nil {
-						fin.Close()
-						fout.Close()
-						fmt.Fprintf(os.Stderr, "\"%s\": %v\n", srcPath, err)
-						continue nextName
-					}
+	o := &options{
+		useModTime:   *useModTime,
+		doCopy:       *doCopy,
+		doMove:       *doMove,
+		doSymlink:    *doSymlink,
+		doHardlink:   *doHardlink,
+		doDedupe:     *doDedupe,
+		doOverwrite:  *doOverwrite,
+		useSuffixes:  *useSuffixes,
+		targetFolder: *targetFolder,
+		hashAlgo:     *hashAlgo,
+		template:     *tmplFlag,
+		sidecar:      sidecarFormat,
+		sidecarHide:  *sidecarHidden,
+		tags:         tags,
+		tz:           *tzFlag,
+	}
 
-					// Write to target:
-					_, err = fout.Write(buf[0:n])
-					if err != nil {
-						fin.Close()
-						fout.Close()
-						fmt.Fprintf(os.Stderr, "\"%s\": %v\n", srcPath, err)
-						continue nextName
-					}
-				}
+	// Always resolve the same Plan, whether reporting it (-dry-run) or
+	// executing it, so a real run can't derive different destinations (or
+	// miss a conflict) than what -dry-run already told the user would
+	// happen:
+	plan := buildPlan(sources, o)
 
-				fin.Close()
-				fout.Close()
+	if *dryRun {
+		PrintPlan(plan, *dryRunJSON)
+		return
+	}
 
-				if source.IsJpeg {
-					// Set mod time of target file to that of source file:
-					err = os.Chtimes(destPath, time.Now(), dateTime)
-					if err != nil {
-						fmt.Fprintf(os.Stderr, "\"%s\": %v\n", srcPath, err)
-						continue nextName
-					}
-				}
-			} else if *doMove {
-				fmt.Printf("mv \"%s\" \"%s\"\n", srcPath, destPath)
-				err := os.Rename(srcPath, destPath)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "\"%s\": %v\n", srcPath, err)
-				}
-			} else if *doSymlink {
-				relName, err := filepath.Rel(*targetFolder, srcPath)
-				fmt.Printf("symlink \"%s\" \"%s\"\n", srcPath, destPath)
-				err = os.Symlink(relName, destPath)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "\"%s\": %v\n", srcPath, err)
-				}
-			} else if *doHardlink {
-				relName, err := filepath.Rel(*targetFolder, srcPath)
-				fmt.Printf("hardlink \"%s\" \"%s\"\n", srcPath, destPath)
-				err = os.Link(relName, destPath)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "\"%s\": %v\n", srcPath, err)
-				}
-			} else {
-				fmt.Printf("\"%s\" \"%s\"\n", srcPath, destPath)
-			}
+	var journal *UndoJournal
+	if *doCopy || *doMove || *doSymlink || *doHardlink || *doDedupe {
+		journalPath := undoJournalPath(*targetFolder, time.Now())
+		var jerr error
+		journal, jerr = NewUndoJournal(journalPath)
+		if jerr != nil {
+			fmt.Fprintln(os.Stderr, jerr)
+			os.Exit(-1)
+			return
 		}
+		defer journal.Close()
+		fmt.Printf("undo journal: %s\n", journalPath)
 	}
+
+	ApplyPlan(plan, o, *jobs, journal)
 }
@@ -0,0 +1,554 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dsoprea/go-exif"
+)
+
+var (
+	errNoMediaTimestamp = errors.New("Could not find a timestamp in this file")
+)
+
+// MediaTimestamp extracts the "taken at" timestamp for path, dispatching on
+// its extension to the appropriate format-specific reader. It returns
+// errNoMediaTimestamp itself (unwrapped, so callers can compare with ==)
+// for an unrecognized extension, and for a recognized format whose reader
+// finds no embedded timestamp.
+func MediaTimestamp(path string) (dateTime time.Time, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errNoMediaTimestamp
+		}
+	}()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		return extractDateTimeOriginal(path)
+	case ".tiff", ".tif", ".dng", ".cr2", ".nef", ".arw":
+		return tiffTimestamp(path)
+	case ".png":
+		return pngTimestamp(path)
+	case ".heic", ".heif":
+		return heicTimestamp(path)
+	case ".mp4", ".mov", ".3gp":
+		return movTimestamp(path)
+	default:
+		err = errNoMediaTimestamp
+		return
+	}
+}
+
+// exifDateTimeFromTags walks an already-collected EXIF tag index for
+// DateTimeOriginal/SubSecTimeOriginal, shared by every format whose
+// timestamp lives in a standard EXIF IFD.
+func exifDateTimeFromTags(index exif.IfdIndex) (dateTime time.Time, err error) {
+	exifIfd, err := index.RootIfd.ChildWithIfdPath("IFD/Exif")
+	if err != nil {
+		return
+	}
+
+	results, err := exifIfd.FindTagWithName("DateTimeOriginal")
+	if len(results) == 0 {
+		err = errNoMediaTimestamp
+		return
+	}
+
+	dateTimeOriginal, err := index.RootIfd.TagValue(results[0])
+	if err != nil {
+		return
+	}
+
+	results, err = exifIfd.FindTagWithName("SubSecTimeOriginal")
+	var subSecTimeOriginal interface{}
+	if len(results) == 1 {
+		subSecTimeOriginal, err = index.RootIfd.TagValue(results[0])
+		if err != nil {
+			return
+		}
+	} else {
+		subSecTimeOriginal = "000"
+	}
+
+	dateTimeFmt := dateTimeOriginal.(string) + "." + subSecTimeOriginal.(string)
+	dateTime, err = time.Parse("2006:01:02 15:04:05.999", dateTimeFmt)
+	return
+}
+
+// exifDateTimeFromRawBytes parses a raw TIFF-formatted EXIF stream (no JPEG
+// APP1 wrapper) and extracts DateTimeOriginal, for formats where the EXIF
+// data isn't embedded in a JPEG (TIFF/RAW, PNG eXIf chunks, HEIC Exif items).
+func exifDateTimeFromRawBytes(rawExif []byte) (dateTime time.Time, err error) {
+	im := exif.NewIfdMapping()
+
+	err = exif.LoadStandardIfds(im)
+	if err != nil {
+		return
+	}
+
+	ti := exif.NewTagIndex()
+
+	_, index, err := exif.Collect(im, ti, rawExif)
+	if err != nil {
+		return
+	}
+
+	return exifDateTimeFromTags(index)
+}
+
+// tiffTimestamp reads DateTimeOriginal from a bare TIFF-based file: TIFF
+// itself, DNG, or a camera raw format (CR2/NEF/ARW) that is a TIFF variant
+// with the same EXIF IFD layout.
+func tiffTimestamp(path string) (dateTime time.Time, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	return exifDateTimeFromRawBytes(data)
+}
+
+// pngChunk is one length-prefixed chunk of a PNG file.
+type pngChunk struct {
+	kind string
+	data []byte
+}
+
+var pngSignature = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}
+
+// readPngChunks walks the chunk stream of a PNG file.
+func readPngChunks(data []byte) ([]pngChunk, error) {
+	if len(data) < len(pngSignature) || !bytes.Equal(data[:len(pngSignature)], pngSignature) {
+		return nil, fmt.Errorf("not a PNG file")
+	}
+
+	var chunks []pngChunk
+	pos := len(pngSignature)
+	for pos+8 <= len(data) {
+		length := binary.BigEndian.Uint32(data[pos : pos+4])
+		kind := string(data[pos+4 : pos+8])
+		start := pos + 8
+		end := start + int(length)
+		if end+4 > len(data) {
+			break
+		}
+		chunks = append(chunks, pngChunk{kind: kind, data: data[start:end]})
+		pos = end + 4 // skip the trailing CRC32
+		if kind == "IEND" {
+			break
+		}
+	}
+	return chunks, nil
+}
+
+// pngTimestamp looks for an embedded "eXIf" chunk (raw EXIF, per the PNG
+// extensions spec) or a tEXt/iTXt "Creation Time" keyword.
+func pngTimestamp(path string) (dateTime time.Time, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	chunks, err := readPngChunks(data)
+	if err != nil {
+		return
+	}
+
+	for _, c := range chunks {
+		if c.kind == "eXIf" {
+			return exifDateTimeFromRawBytes(c.data)
+		}
+	}
+
+	for _, c := range chunks {
+		if c.kind != "tEXt" && c.kind != "iTXt" {
+			continue
+		}
+		sep := bytes.IndexByte(c.data, 0)
+		if sep < 0 {
+			continue
+		}
+		keyword := string(c.data[:sep])
+		if keyword != "Creation Time" {
+			continue
+		}
+		text := c.data[sep+1:]
+		if c.kind == "iTXt" {
+			// iTXt: compression flag, compression method, language tag\0,
+			// translated keyword\0, then the text. Compressed text is
+			// not inflated, so it is skipped.
+			if len(text) < 2 || text[0] != 0 {
+				continue
+			}
+			text = text[2:]
+			for n := 0; n < 2 && text != nil; n++ {
+				if i := bytes.IndexByte(text, 0); i >= 0 {
+					text = text[i+1:]
+				} else {
+					text = nil
+				}
+			}
+			if text == nil {
+				continue
+			}
+		}
+		value := string(bytes.TrimRight(text, "\x00"))
+		// PNG's "Creation Time" convention is RFC 1123 (as used by
+		// libpng's pngdate.c), e.g. "29 Aug 2026 14:15:16 +0000", with
+		// or without a leading weekday.
+		dateTime, err = time.Parse(time.RFC1123Z, value)
+		if err != nil {
+			dateTime, err = time.Parse(time.RFC1123, value)
+		}
+		if err != nil {
+			dateTime, err = time.Parse("2 Jan 2006 15:04:05 -0700", value)
+		}
+		return
+	}
+
+	err = errNoMediaTimestamp
+	return
+}
+
+// readBoxes walks a flat or nested ISOBMFF (MP4/MOV/HEIF) box stream,
+// calling visit for every box found directly under data. visit returns
+// false to stop the walk early.
+func readBoxes(data []byte, visit func(boxType string, body []byte) bool) {
+	pos := 0
+	for pos+8 <= len(data) {
+		size := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		boxType := string(data[pos+4 : pos+8])
+		headerLen := 8
+		if size == 1 {
+			// 64-bit extended size.
+			if pos+16 > len(data) {
+				return
+			}
+			size = int(binary.BigEndian.Uint64(data[pos+8 : pos+16]))
+			headerLen = 16
+		} else if size == 0 {
+			size = len(data) - pos
+		}
+		if size < headerLen || pos+size > len(data) {
+			return
+		}
+
+		if !visit(boxType, data[pos+headerLen:pos+size]) {
+			return
+		}
+		pos += size
+	}
+}
+
+// findBox returns the body of the first top-level box of the given type.
+func findBox(data []byte, boxType string) []byte {
+	var found []byte
+	readBoxes(data, func(t string, body []byte) bool {
+		if t == boxType {
+			found = body
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// mp4Epoch is the MP4/QuickTime "creation_time" epoch: 1904-01-01 UTC.
+var mp4Epoch = time.Date(1904, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// movTimestamp reads the moov/mvhd box's creation_time field, which is
+// seconds since 1904-01-01 UTC.
+func movTimestamp(path string) (dateTime time.Time, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	moov := findBox(data, "moov")
+	if moov == nil {
+		err = errNoMediaTimestamp
+		return
+	}
+
+	mvhd := findBox(moov, "mvhd")
+	if mvhd == nil || len(mvhd) < 4 {
+		err = errNoMediaTimestamp
+		return
+	}
+
+	version := mvhd[0]
+	var creationTime uint64
+	if version == 1 {
+		if len(mvhd) < 4+8 {
+			err = errNoMediaTimestamp
+			return
+		}
+		creationTime = binary.BigEndian.Uint64(mvhd[4:12])
+	} else {
+		if len(mvhd) < 4+4 {
+			err = errNoMediaTimestamp
+			return
+		}
+		creationTime = uint64(binary.BigEndian.Uint32(mvhd[4:8]))
+	}
+
+	if creationTime == 0 {
+		err = errNoMediaTimestamp
+		return
+	}
+
+	dateTime = mp4Epoch.Add(time.Duration(creationTime) * time.Second)
+	return
+}
+
+// heicTimestamp locates the EXIF item referenced from the HEIF/HEIC 'meta'
+// box and parses its embedded TIFF/EXIF stream.
+func heicTimestamp(path string) (dateTime time.Time, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	meta := findBox(data, "meta")
+	if meta == nil {
+		err = errNoMediaTimestamp
+		return
+	}
+	// 'meta' is a "full box": 4 bytes of version/flags precede its children.
+	if len(meta) < 4 {
+		err = errNoMediaTimestamp
+		return
+	}
+	meta = meta[4:]
+
+	itemID, ok := heicExifItemID(meta)
+	if !ok {
+		err = errNoMediaTimestamp
+		return
+	}
+
+	payload, ok := heicItemData(data, meta, itemID)
+	if !ok {
+		err = errNoMediaTimestamp
+		return
+	}
+
+	// Per ISO/IEC 23008-12, an Exif item payload begins with a 4-byte
+	// big-endian offset to the start of the TIFF header (commonly 6, to
+	// skip a leading "Exif\0\0").
+	if len(payload) < 4 {
+		err = errNoMediaTimestamp
+		return
+	}
+	tiffOffset := int(binary.BigEndian.Uint32(payload[0:4])) + 4
+	if tiffOffset < 0 || tiffOffset >= len(payload) {
+		err = errNoMediaTimestamp
+		return
+	}
+
+	return exifDateTimeFromRawBytes(payload[tiffOffset:])
+}
+
+// heicExifItemID scans the 'iinf' box under meta for an item of type "Exif"
+// and returns its item_ID.
+func heicExifItemID(meta []byte) (itemID uint32, ok bool) {
+	iinf := findBox(meta, "iinf")
+	if iinf == nil || len(iinf) < 4 {
+		return
+	}
+	// iinf is a full box too; entry_count is 16-bit for version 0, 32-bit
+	// for version >= 1 (mirroring the item_count handling in heicItemData).
+	version := iinf[0]
+	body := iinf[4:]
+	entryCountSize := 2
+	if version >= 1 {
+		entryCountSize = 4
+	}
+	if len(body) < entryCountSize {
+		return
+	}
+
+	found := false
+	readBoxes(body[entryCountSize:], func(t string, infe []byte) bool {
+		if t != "infe" || len(infe) < 4+4+4 {
+			return true
+		}
+		// infe is a full box; version >= 2 uses a 16 or 32-bit item_ID
+		// followed by a 4-byte item_type FourCC.
+		version := infe[0]
+		var id uint32
+		var itemType string
+		if version >= 3 {
+			// version >= 3: 32-bit item_ID, then a 16-bit
+			// item_protection_index, then the item_type FourCC.
+			if len(infe) < 4+4+2+4 {
+				return true
+			}
+			id = binary.BigEndian.Uint32(infe[4:8])
+			itemType = string(infe[10:14])
+		} else {
+			id = uint32(binary.BigEndian.Uint16(infe[4:6]))
+			itemType = string(infe[8:12])
+		}
+		if itemType == "Exif" {
+			itemID = id
+			ok = true
+			found = true
+			return false
+		}
+		return true
+	})
+	_ = found
+	return
+}
+
+// readIlocInt reads an n-byte (0, 4, or 8) big-endian unsigned integer from
+// body at pos. n == 0 yields zero with no bytes consumed, per the iloc spec
+// allowing zero-sized offset/length fields.
+func readIlocInt(body []byte, pos int, n int) (uint64, bool) {
+	if n == 0 {
+		return 0, true
+	}
+	if pos+n > len(body) {
+		return 0, false
+	}
+	switch n {
+	case 4:
+		return uint64(binary.BigEndian.Uint32(body[pos : pos+4])), true
+	case 8:
+		return binary.BigEndian.Uint64(body[pos : pos+8]), true
+	default:
+		return 0, false
+	}
+}
+
+// heicItemData resolves itemID through the 'iloc' box to an extent and
+// returns the corresponding slice of data, the whole file's contents.
+//
+// NOTE: this handles construction_method 0 (file-relative offsets, the
+// common case) and 1 (offsets relative to the 'idat' box within meta); it
+// does not handle construction_method 2 (offsets relative to another item),
+// which real-world single-image HEIC files don't use.
+func heicItemData(data []byte, meta []byte, itemID uint32) ([]byte, bool) {
+	iloc := findBox(meta, "iloc")
+	if iloc == nil || len(iloc) < 4 {
+		return nil, false
+	}
+	version := iloc[0]
+	body := iloc[4:]
+	if len(body) < 2 {
+		return nil, false
+	}
+
+	offsetSize := int(body[0] >> 4)
+	lengthSize := int(body[0] & 0xf)
+	baseOffsetSize := int(body[1] >> 4)
+	indexSize := int(body[1] & 0xf)
+	pos := 2
+
+	var itemCount int
+	if version < 2 {
+		if pos+2 > len(body) {
+			return nil, false
+		}
+		itemCount = int(binary.BigEndian.Uint16(body[pos : pos+2]))
+		pos += 2
+	} else {
+		if pos+4 > len(body) {
+			return nil, false
+		}
+		itemCount = int(binary.BigEndian.Uint32(body[pos : pos+4]))
+		pos += 4
+	}
+
+	for i := 0; i < itemCount; i++ {
+		var id uint32
+		if version < 2 {
+			if pos+2 > len(body) {
+				return nil, false
+			}
+			id = uint32(binary.BigEndian.Uint16(body[pos : pos+2]))
+			pos += 2
+		} else {
+			if pos+4 > len(body) {
+				return nil, false
+			}
+			id = binary.BigEndian.Uint32(body[pos : pos+4])
+			pos += 4
+		}
+
+		constructionMethod := 0
+		if version == 1 || version == 2 {
+			if pos+2 > len(body) {
+				return nil, false
+			}
+			constructionMethod = int(binary.BigEndian.Uint16(body[pos:pos+2]) & 0xf)
+			pos += 2
+		}
+
+		pos += 2 // data_reference_index
+		baseOffset, ok := readIlocInt(body, pos, baseOffsetSize)
+		if !ok {
+			return nil, false
+		}
+		pos += baseOffsetSize
+
+		if pos+2 > len(body) {
+			return nil, false
+		}
+		extentCount := int(binary.BigEndian.Uint16(body[pos : pos+2]))
+		pos += 2
+
+		for e := 0; e < extentCount; e++ {
+			if (version == 1 || version == 2) && indexSize > 0 {
+				pos += indexSize
+			}
+			extentOffset, ok := readIlocInt(body, pos, offsetSize)
+			if !ok {
+				return nil, false
+			}
+			pos += offsetSize
+			extentLength, ok := readIlocInt(body, pos, lengthSize)
+			if !ok {
+				return nil, false
+			}
+			pos += lengthSize
+
+			if id != itemID {
+				continue
+			}
+
+			switch constructionMethod {
+			case 0:
+				start := int(baseOffset + extentOffset)
+				end := start + int(extentLength)
+				if start < 0 || end > len(data) || end < start {
+					return nil, false
+				}
+				return data[start:end], true
+			case 1:
+				idat := findBox(meta, "idat")
+				if idat == nil {
+					return nil, false
+				}
+				start := int(baseOffset + extentOffset)
+				end := start + int(extentLength)
+				if start < 0 || end > len(idat) || end < start {
+					return nil, false
+				}
+				return idat[start:end], true
+			default:
+				return nil, false
+			}
+		}
+	}
+
+	return nil, false
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+)
+
+// WipTracker records destination paths that are currently being written so
+// that, on interrupt, any half-written files can be cleaned up instead of
+// left behind as corrupt output.
+type WipTracker struct {
+	mu    sync.Mutex
+	paths map[string]bool
+}
+
+// NewWipTracker returns an empty WipTracker.
+func NewWipTracker() *WipTracker {
+	return &WipTracker{paths: make(map[string]bool)}
+}
+
+// Add marks path as being written.
+func (w *WipTracker) Add(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.paths[path] = true
+}
+
+// Remove marks path as complete (or abandoned before any bytes were written).
+func (w *WipTracker) Remove(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.paths, path)
+}
+
+// Cleanup removes every path still marked as in-progress.
+func (w *WipTracker) Cleanup() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for path := range w.paths {
+		os.Remove(path)
+	}
+}
+
+// installInterruptHandler arranges for wip's half-written files to be
+// removed if the process receives SIGINT/Ctrl-C.
+func installInterruptHandler(wip *WipTracker) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	go func() {
+		<-sigCh
+		fmt.Fprintln(os.Stderr, "\ninterrupted, cleaning up in-progress files...")
+		wip.Cleanup()
+		os.Exit(1)
+	}()
+}
+
+// pipelineJob pairs a PlanEntry with its original position in the plan, so
+// results can be re-ordered back to that position after parallel processing.
+type pipelineJob struct {
+	index int
+	entry *PlanEntry
+}
+
+// pipelineResult is the output of applying one PlanEntry: the stdout lines
+// it would have printed, collected rather than written directly so the
+// serializer goroutine can emit them in scan order.
+type pipelineResult struct {
+	index  int
+	output string
+}
+
+// ApplyPlan executes plan with jobs worker goroutines, applying each
+// non-skip entry via applyPlanEntry, and prints each entry's stdout output
+// once all entries ahead of it in the plan have also been printed, so stdout
+// ordering matches a single-goroutine run regardless of which worker
+// finishes first. Conflicts are printed to stderr before any entry runs;
+// skip reasons and per-file errors go to stderr as each worker meets them,
+// so their order across workers is not fixed.
+//
+// It acts on exactly the destinations and conflict resolutions plan already
+// computed, rather than re-deriving them per entry, so a real run can't
+// disagree with -dry-run's report of the same sources.
+func ApplyPlan(plan *Plan, o *options, jobs int, journal *UndoJournal) {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	for _, conflict := range plan.Conflicts {
+		fmt.Fprintf(os.Stderr, "conflict \"%s\": %s (from %s)\n", conflict.Dst, conflict.Reason, strings.Join(conflict.Srcs, ", "))
+	}
+
+	wip := NewWipTracker()
+	installInterruptHandler(wip)
+
+	jobsCh := make(chan pipelineJob)
+	resultsCh := make(chan pipelineResult)
+
+	var workers sync.WaitGroup
+	workers.Add(jobs)
+	for i := 0; i < jobs; i++ {
+		go func() {
+			defer workers.Done()
+			for j := range jobsCh {
+				var output string
+				if j.entry.Action == "skip" {
+					fmt.Fprintf(os.Stderr, "skip \"%s\": %s\n", j.entry.Src, j.entry.Reason)
+				} else {
+					output = applyPlanEntry(j.entry, o, wip, journal)
+				}
+				resultsCh <- pipelineResult{index: j.index, output: output}
+			}
+		}()
+	}
+
+	go func() {
+		workers.Wait()
+		close(resultsCh)
+	}()
+
+	go func() {
+		for i := range plan.Entries {
+			jobsCh <- pipelineJob{index: i, entry: &plan.Entries[i]}
+		}
+		close(jobsCh)
+	}()
+
+	// Serializer: buffer out-of-order results until the next-in-order one
+	// arrives, then flush.
+	pending := make(map[int]string, jobs)
+	next := 0
+	for r := range resultsCh {
+		pending[r.index] = r.output
+		for {
+			out, ok := pending[next]
+			if !ok {
+				break
+			}
+			fmt.Print(out)
+			delete(pending, next)
+			next++
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// PlanEntry is one {src, dst, action, reason} tuple -dry-run would execute.
+//
+// The unexported fields carry what Apply needs to actually perform the
+// entry's action; they're not part of the -dry-run report (encoding/json
+// skips unexported fields). They are unset for entries skipped because the
+// timestamp or destination couldn't be resolved, and left set for entries
+// skipped because an earlier entry already claimed the same destination.
+type PlanEntry struct {
+	Src    string `json:"src"`
+	Dst    string `json:"dst"`
+	Action string `json:"action"`
+	Reason string `json:"reason,omitempty"`
+
+	source      *Source
+	destExt     string
+	dateTime    time.Time
+	utcDateTime time.Time
+}
+
+// PlanConflict flags a destination more than one planned entry would touch,
+// or that collides with something already on disk.
+type PlanConflict struct {
+	Dst    string   `json:"dst"`
+	Srcs   []string `json:"srcs"`
+	Reason string   `json:"reason"`
+}
+
+// Plan is the full result of scanning sources without touching the
+// filesystem: what -dry-run prints, and what ApplyPlan actually executes.
+type Plan struct {
+	Entries   []PlanEntry    `json:"entries"`
+	Conflicts []PlanConflict `json:"conflicts,omitempty"`
+}
+
+// planAction names the action buildPlan would record, mirroring
+// applyPlanEntry's own dispatch order (dedupe takes precedence, then
+// cp/mv/symlink/hardlink, else a no-op "print").
+func planAction(o *options) string {
+	switch {
+	case o.doDedupe:
+		return "dedupe"
+	case o.doCopy:
+		return "cp"
+	case o.doMove:
+		return "mv"
+	case o.doSymlink:
+		return "symlink"
+	case o.doHardlink:
+		return "hardlink"
+	default:
+		return "print"
+	}
+}
+
+// buildPlan resolves every source's destination (reusing the same
+// timestamp/template/overwrite logic a real run would use) without
+// performing any action, then looks for conflicts: two sources resolving to
+// the same destination, destinations that collide with a pre-existing
+// unrelated file, and -mv targets that overlap their own source.
+//
+// ApplyPlan executes exactly this plan rather than recomputing destinations
+// itself, so a real run can't disagree with what -dry-run reported, and
+// can't race: when -overwrite isn't set, the first entry in scan order to
+// reach a given destination claims it, and every later entry that resolves
+// to the same destination is turned into a "skip" here (deterministically,
+// by scan order) instead of letting concurrent workers fight over it via
+// filesystem state.
+//
+// It runs single-threaded rather than through the worker pool: conflict
+// detection needs every entry before it can say anything about collisions,
+// so there's nothing to gain from parallelizing this pass.
+func buildPlan(sources []*Source, o *options) *Plan {
+	plan := &Plan{}
+	action := planAction(o)
+
+	dstSources := make(map[string][]string)
+	claimed := make(map[string]bool)
+
+	for i, source := range sources {
+		var dateTime, utcDateTime time.Time
+		var timestampFilename string
+
+		if source.IsMedia {
+			var err error
+			dateTime, utcDateTime, err = resolveSourceTimestamp(source, o)
+			if err != nil {
+				plan.Entries = append(plan.Entries, PlanEntry{
+					Src:    source.Path,
+					Action: "skip",
+					Reason: err.Error(),
+				})
+				continue
+			}
+			timestampFilename = timestampBase(dateTime)
+		}
+
+		for _, name := range source.RelatedFilenames {
+			srcPath := filepath.Join(source.Dir, name)
+			destExt := strings.ToLower(filepath.Ext(srcPath))
+
+			destPath, err := computeDestination(source, name, dateTime, timestampFilename, destExt, o, i)
+			if err != nil {
+				plan.Entries = append(plan.Entries, PlanEntry{
+					Src:    srcPath,
+					Action: "skip",
+					Reason: err.Error(),
+				})
+				continue
+			}
+
+			if o.doMove && filepath.Clean(srcPath) == filepath.Clean(destPath) {
+				plan.Conflicts = append(plan.Conflicts, PlanConflict{
+					Dst:    destPath,
+					Srcs:   []string{srcPath},
+					Reason: "move target is its own source",
+				})
+				continue
+			}
+
+			dstSources[destPath] = append(dstSources[destPath], srcPath)
+
+			entry := PlanEntry{
+				Src:         srcPath,
+				Dst:         destPath,
+				Action:      action,
+				source:      source,
+				destExt:     destExt,
+				dateTime:    dateTime,
+				utcDateTime: utcDateTime,
+			}
+
+			if !o.doOverwrite && claimed[destPath] {
+				entry.Action = "skip"
+				entry.Reason = fmt.Sprintf("not overwriting \"%s\": already claimed by an earlier source in this run (e.g. a same-second burst without SubSecTimeOriginal)", destPath)
+			} else {
+				claimed[destPath] = true
+			}
+
+			plan.Entries = append(plan.Entries, entry)
+		}
+	}
+
+	for dst, srcs := range dstSources {
+		if len(srcs) > 1 {
+			plan.Conflicts = append(plan.Conflicts, PlanConflict{
+				Dst:    dst,
+				Srcs:   srcs,
+				Reason: "multiple sources resolve to the same destination (e.g. a same-second burst without SubSecTimeOriginal)",
+			})
+		} else if !o.doOverwrite && PathExists(dst) {
+			plan.Conflicts = append(plan.Conflicts, PlanConflict{
+				Dst:    dst,
+				Srcs:   srcs,
+				Reason: "destination already exists",
+			})
+		}
+	}
+
+	return plan
+}
+
+// PrintPlan writes plan to stdout, as JSON if asJSON else as a short
+// human-readable report.
+func PrintPlan(plan *Plan, asJSON bool) {
+	if asJSON {
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	for _, entry := range plan.Entries {
+		if entry.Action == "skip" {
+			fmt.Printf("skip \"%s\": %s\n", entry.Src, entry.Reason)
+			continue
+		}
+		fmt.Printf("%s \"%s\" \"%s\"\n", entry.Action, entry.Src, entry.Dst)
+	}
+
+	for _, conflict := range plan.Conflicts {
+		fmt.Printf("conflict \"%s\": %s (from %s)\n", conflict.Dst, conflict.Reason, strings.Join(conflict.Srcs, ", "))
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// options bundles the command-line flags needed while processing a single
+// Source, so that function can run concurrently across worker goroutines
+// without closing over main's local flag variables directly.
+type options struct {
+	useModTime   bool
+	doCopy       bool
+	doMove       bool
+	doSymlink    bool
+	doHardlink   bool
+	doDedupe     bool
+	doOverwrite  bool
+	useSuffixes  bool
+	targetFolder string
+	hashAlgo     string
+	template     string
+	sidecar      SidecarFormat
+	sidecarHide  bool
+	tags         []string
+	tz           string
+}
+
+// applyPlanEntry performs the configured action (cp/mv/symlink/hardlink/
+// dedupe/print-only) for one non-skip PlanEntry from a Plan that buildPlan
+// produced. Rather than writing to stdout directly, it returns the line
+// that would have been printed, so that callers applying multiple entries
+// concurrently can still emit them in a deterministic order.
+//
+// Acting on entry.Dst (computed once, up front, by buildPlan) rather than
+// recomputing the destination here is what lets Apply honor buildPlan's
+// conflict detection instead of re-deriving (and possibly racing on)
+// destinations independently per worker.
+func applyPlanEntry(entry *PlanEntry, o *options, wip *WipTracker, journal *UndoJournal) string {
+	var out strings.Builder
+
+	srcPath := entry.Src
+	destPath := entry.Dst
+	destExt := entry.destExt
+	source := entry.source
+	dateTime := entry.dateTime
+	utcDateTime := entry.utcDateTime
+
+	filePerm := os.FileMode(0644)
+	if o.doCopy || o.doMove || o.doSymlink || o.doHardlink || o.doDedupe {
+		stat := source.File
+
+		// Take file permissions of original file:
+		filePerm = stat.Mode() & os.ModePerm
+
+		// Compute directory permissions by setting 'x' bit for each corresponding 'r' bit:
+		// e.g. 'r--r--r--' => 'r-xr-xr-x'
+		dirPerm := filePerm | ((filePerm & 0444) >> 2)
+
+		// Make directory for target file to be contained in:
+		err := os.MkdirAll(filepath.Dir(destPath), dirPerm)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\"%s\": %v\n", srcPath, err)
+			return out.String()
+		}
+
+		// Remove target file if overwriting is enabled:
+		if o.doOverwrite {
+			os.Remove(destPath)
+		}
+	}
+
+	// Figure out what to do with the file:
+	if o.doDedupe {
+		fmt.Fprintf(&out, "dedupe \"%s\" \"%s\"\n", srcPath, destPath)
+
+		contentRoot := filepath.Join(o.targetFolder, "content")
+		contentPath, err := putContent(srcPath, contentRoot, o.hashAlgo, destExt, filePerm, wip)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\"%s\": %v\n", srcPath, err)
+			return out.String()
+		}
+
+		wip.Add(destPath)
+		if err = linkToContent(destPath, contentPath, o.doSymlink); err != nil {
+			// No link was created, so whatever is at destPath isn't ours:
+			wip.Remove(destPath)
+			fmt.Fprintf(os.Stderr, "\"%s\": %v\n", srcPath, err)
+			return out.String()
+		}
+		wip.Remove(destPath)
+		recordUndo(journal, "dedupe", srcPath, destPath)
+	} else if o.doCopy {
+		fmt.Fprintf(&out, "cp \"%s\" \"%s\"\n", srcPath, destPath)
+
+		wip.Add(destPath)
+		warnings, err := copyPreserving(srcPath, destPath, source.File, filePerm)
+		for _, w := range warnings {
+			fmt.Fprintf(os.Stderr, "\"%s\": %v\n", srcPath, w)
+		}
+		if err != nil {
+			if os.IsExist(err) {
+				// destPath already existed and nothing was written to it:
+				wip.Remove(destPath)
+			}
+			fmt.Fprintf(os.Stderr, "\"%s\": %v\n", srcPath, err)
+			return out.String()
+		}
+
+		if source.IsMedia {
+			// Set mod time of target file to the photo's own timestamp,
+			// taking precedence over the source file's mtime that
+			// copyPreserving just carried over:
+			err = os.Chtimes(destPath, time.Now(), dateTime)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\"%s\": %v\n", srcPath, err)
+				return out.String()
+			}
+		}
+		wip.Remove(destPath)
+		recordUndo(journal, "cp", srcPath, destPath)
+	} else if o.doMove {
+		fmt.Fprintf(&out, "mv \"%s\" \"%s\"\n", srcPath, destPath)
+		err := os.Rename(srcPath, destPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\"%s\": %v\n", srcPath, err)
+		} else {
+			recordUndo(journal, "mv", srcPath, destPath)
+		}
+	} else if o.doSymlink {
+		relName, err := filepath.Rel(o.targetFolder, srcPath)
+		fmt.Fprintf(&out, "symlink \"%s\" \"%s\"\n", srcPath, destPath)
+		err = os.Symlink(relName, destPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\"%s\": %v\n", srcPath, err)
+		} else {
+			recordUndo(journal, "symlink", srcPath, destPath)
+		}
+	} else if o.doHardlink {
+		relName, err := filepath.Rel(o.targetFolder, srcPath)
+		fmt.Fprintf(&out, "hardlink \"%s\" \"%s\"\n", srcPath, destPath)
+		err = os.Link(relName, destPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\"%s\": %v\n", srcPath, err)
+		} else {
+			recordUndo(journal, "hardlink", srcPath, destPath)
+		}
+	} else {
+		fmt.Fprintf(&out, "\"%s\" \"%s\"\n", srcPath, destPath)
+	}
+
+	didAct := o.doCopy || o.doMove || o.doSymlink || o.doHardlink || o.doDedupe
+	if didAct && source.IsMedia && o.sidecar != "" && o.sidecar != SidecarNone {
+		if err := writeSidecarFor(srcPath, destPath, utcDateTime, o); err != nil {
+			fmt.Fprintf(os.Stderr, "\"%s\": %v\n", srcPath, err)
+		}
+	}
+
+	return out.String()
+}
+
+// writeSidecarFor builds and writes the metadata sidecar for one renamed
+// file, per the -sidecar/-sidecar-hidden/-tags flags.
+func writeSidecarFor(srcPath, destPath string, utcDateTime time.Time, o *options) error {
+	record := SidecarRecord{
+		SourcePath: srcPath,
+		Timestamp:  utcDateTime,
+		Tags:       o.tags,
+	}
+
+	info := readCameraInfo(srcPath)
+	record.CameraMake = info.Make
+	record.CameraModel = info.Model
+	record.ISO = info.ISO
+
+	if digest, _, err := hashFile(srcPath, o.hashAlgo); err == nil {
+		record.Hash = digest
+		record.HashAlgorithm = o.hashAlgo
+	}
+
+	return writeSidecar(destPath, o.sidecar, o.sidecarHide, record)
+}
+
+// recordUndo appends action to journal, if one is active, logging (rather
+// than failing the file) if the journal write itself fails.
+func recordUndo(journal *UndoJournal, action, src, dst string) {
+	if journal == nil {
+		return
+	}
+	if err := journal.Record(action, src, dst); err != nil {
+		fmt.Fprintf(os.Stderr, "undo journal: %v\n", err)
+	}
+}
+
+// computeDestination works out name's destination path within source: the
+// template-rendered path when -template/-bydate is set and source is a
+// primary media file, otherwise the traditional <target>/<dir>/<timestamp>
+// for a media source and each of its related filenames alike (or
+// <target>/<dir>/<name> for a non-media source), keeping name's own
+// extension either way. It also applies
+// the -overwrite/-suffixes collision rules, which is why it needs to touch
+// the filesystem (PathExists) rather than being a pure path computation.
+//
+// Only called from buildPlan, so both -dry-run and a real run (which
+// applies buildPlan's own output via applyPlanEntry) always agree on
+// destinations.
+//
+// scanIndex is source's position in the original scan order, forwarded to
+// newTemplateData for {{.Sequence}}.
+func computeDestination(source *Source, name string, dateTime time.Time, timestampFilename, destExt string, o *options, scanIndex int) (string, error) {
+	var destFilename string
+	if source.IsMedia {
+		destFilename = timestampFilename
+	} else {
+		destFilename = NoExt(name)
+	}
+
+	var destPath string
+	if o.template != "" && source.IsMedia {
+		data, err := newTemplateData(source, dateTime, destExt, scanIndex)
+		if err != nil {
+			return "", err
+		}
+
+		rendered, err := renderTemplate(o.template, data)
+		if err != nil {
+			return "", err
+		}
+
+		destPath = filepath.Join(o.targetFolder, filepath.FromSlash(rendered))
+	} else {
+		destPath = filepath.Join(o.targetFolder, source.Dir, destFilename+destExt)
+	}
+
+	if !o.doOverwrite && PathExists(destPath) {
+		if !o.useSuffixes {
+			return "", fmt.Errorf("not overwriting existing file \"%s\"", destPath)
+		}
+
+		// Generate a unique suffix and retry, appending it to the path
+		// already computed above (template-rendered or traditional) so a
+		// collision doesn't relocate the file to a different layout:
+		destPathExt := filepath.Ext(destPath)
+		destPathBase := strings.TrimSuffix(destPath, destPathExt)
+		for counter := 1; ; counter++ {
+			candidate := fmt.Sprintf("%s_%d%s", destPathBase, counter, destPathExt)
+			if !PathExists(candidate) {
+				destPath = candidate
+				break
+			}
+		}
+	}
+
+	return destPath, nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SidecarFormat selects the -sidecar output format.
+type SidecarFormat string
+
+const (
+	SidecarNone SidecarFormat = "none"
+	SidecarJSON SidecarFormat = "json"
+	SidecarYAML SidecarFormat = "yaml"
+)
+
+// ParseSidecarFormat validates a -sidecar flag value.
+func ParseSidecarFormat(s string) (SidecarFormat, error) {
+	switch SidecarFormat(s) {
+	case SidecarNone, SidecarJSON, SidecarYAML:
+		return SidecarFormat(s), nil
+	default:
+		return "", &sidecarFormatError{s}
+	}
+}
+
+type sidecarFormatError struct{ value string }
+
+func (e *sidecarFormatError) Error() string {
+	return "unknown -sidecar format \"" + e.value + "\" (want json, yaml, or none)"
+}
+
+// SidecarRecord is what gets written to (and read from) a sidecar file: the
+// parsed metadata for one renamed file, tool-agnostic enough to be a durable
+// record of what was renamed to what.
+type SidecarRecord struct {
+	SourcePath    string    `json:"source_path" yaml:"source_path"`
+	Timestamp     time.Time `json:"timestamp" yaml:"timestamp"`
+	CameraMake    string    `json:"camera_make,omitempty" yaml:"camera_make,omitempty"`
+	CameraModel   string    `json:"camera_model,omitempty" yaml:"camera_model,omitempty"`
+	ISO           int       `json:"iso,omitempty" yaml:"iso,omitempty"`
+	Hash          string    `json:"hash,omitempty" yaml:"hash,omitempty"`
+	HashAlgorithm string    `json:"hash_algorithm,omitempty" yaml:"hash_algorithm,omitempty"`
+	Tags          []string  `json:"tags,omitempty" yaml:"tags,omitempty"`
+}
+
+// sidecarPath returns the sidecar path for destPath in the given format,
+// optionally dotfile-hidden.
+func sidecarPath(destPath string, format SidecarFormat, hidden bool) string {
+	dir, base := filepath.Split(destPath)
+	name := base + "." + string(format)
+	if hidden {
+		name = "." + name
+	}
+	return filepath.Join(dir, name)
+}
+
+// writeSidecar marshals record as JSON or YAML (per format) to destPath's
+// sidecar file. A format of SidecarNone is a no-op.
+func writeSidecar(destPath string, format SidecarFormat, hidden bool, record SidecarRecord) error {
+	if format == SidecarNone {
+		return nil
+	}
+
+	var data []byte
+	var err error
+	switch format {
+	case SidecarJSON:
+		data, err = json.MarshalIndent(record, "", "  ")
+	case SidecarYAML:
+		data, err = yaml.Marshal(record)
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(sidecarPath(destPath, format, hidden), data, 0644)
+}
+
+// ingestSidecarTimestamp looks for a companion .json/.yaml/.xmp sidecar next
+// to srcPath and, if one exists with a timestamp, returns it. This lets a
+// prior tool run's sidecar (or an exiftool-corrected XMP) override EXIF,
+// which is useful for scanned photos with no EXIF of their own.
+func ingestSidecarTimestamp(srcPath string) (time.Time, bool) {
+	base := NoExt(srcPath)
+	candidates := []string{
+		srcPath + ".json",
+		srcPath + ".yaml",
+		base + ".json",
+		base + ".yaml",
+		base + ".xmp",
+	}
+
+	for _, candidate := range candidates {
+		if !PathExists(candidate) {
+			continue
+		}
+		if t, ok := readSidecarTimestamp(candidate); ok {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func readSidecarTimestamp(path string) (time.Time, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	switch filepath.Ext(path) {
+	case ".json":
+		var record SidecarRecord
+		if err := json.Unmarshal(data, &record); err != nil || record.Timestamp.IsZero() {
+			return time.Time{}, false
+		}
+		return record.Timestamp, true
+	case ".yaml":
+		var record SidecarRecord
+		if err := yaml.Unmarshal(data, &record); err != nil || record.Timestamp.IsZero() {
+			return time.Time{}, false
+		}
+		return record.Timestamp, true
+	case ".xmp":
+		return readXMPTimestamp(data)
+	default:
+		return time.Time{}, false
+	}
+}
+
+// xmpDescription captures just the date fields jpeg-renamer cares about out
+// of an XMP packet's rdf:Description element; everything else is ignored.
+type xmpDescription struct {
+	DateTimeOriginal string `xml:"DateTimeOriginal,attr"`
+	CreateDate       string `xml:"CreateDate,attr"`
+}
+
+type xmpRDF struct {
+	Description []xmpDescription `xml:"Description"`
+}
+
+type xmpMeta struct {
+	RDF xmpRDF `xml:"RDF"`
+}
+
+// readXMPTimestamp pulls exif:DateTimeOriginal (preferred) or
+// xmp:CreateDate out of an XMP packet, both of which are formatted per
+// ISO 8601 (the same layout time.RFC3339 parses).
+func readXMPTimestamp(data []byte) (time.Time, bool) {
+	var meta xmpMeta
+	if err := xml.Unmarshal(data, &meta); err != nil {
+		return time.Time{}, false
+	}
+
+	for _, desc := range meta.RDF.Description {
+		value := desc.DateTimeOriginal
+		if value == "" {
+			value = desc.CreateDate
+		}
+		if value == "" {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+	"time"
+)
+
+// bydateTemplate is the `-bydate` shortcut: a year/month tree using the
+// same timestamp-based basename the tool has always produced.
+const bydateTemplate = `{{.Year}}/{{.Month}}/{{.TimestampBase}}{{.Ext}}`
+
+// TemplateData is the set of fields a `-template` string can reference to
+// build a destination path for a Source.
+type TemplateData struct {
+	// Date is the media's parsed timestamp.
+	Date time.Time
+	// Year, Month, Day are convenience strings derived from Date (e.g.
+	// "2026", "07", "27").
+	Year, Month, Day string
+	// TimestampBase is the tool's traditional "20060102_150405_NNN"
+	// basename, for templates that just want to relocate it into
+	// subdirectories without changing the name itself.
+	TimestampBase string
+	// CameraMake and CameraModel come from the EXIF Make/Model tags, when
+	// readable; empty otherwise.
+	CameraMake, CameraModel string
+	// ISO is the EXIF ISOSpeedRatings value, or 0 if not readable.
+	ISO int
+	// OriginalBasename is the source file's name without its extension.
+	OriginalBasename string
+	// Ext is the destination extension, including the leading dot.
+	Ext string
+	// MD5 and SHA256 are hex digests of the file's content.
+	MD5, SHA256 string
+	// Sequence is source's position in the scan order, starting at 1. It
+	// comes from the scan itself (not a counter incremented as workers
+	// finish), so it's the same regardless of -jobs or worker scheduling.
+	Sequence int64
+}
+
+// newTemplateData builds the template context for source and the parsed
+// dateTime. scanIndex is source's position in the original scan order
+// (0-based). It hashes and reads EXIF from source.Path (the primary media
+// file's own walked path), exactly as resolveSourceTimestamp does, rather
+// than the scan-relative path of whichever related filename is currently
+// being rendered, so template fields are correct regardless of cwd and
+// describe the media file itself even for its companion filenames.
+func newTemplateData(source *Source, dateTime time.Time, destExt string, scanIndex int) (TemplateData, error) {
+	md5Digest, _, err := hashFile(source.Path, "md5")
+	if err != nil {
+		return TemplateData{}, err
+	}
+	sha256Digest, _, err := hashFile(source.Path, "sha256")
+	if err != nil {
+		return TemplateData{}, err
+	}
+
+	info := readCameraInfo(source.Path)
+
+	return TemplateData{
+		Date:             dateTime,
+		Year:             dateTime.Format("2006"),
+		Month:            dateTime.Format("01"),
+		Day:              dateTime.Format("02"),
+		TimestampBase:    timestampBase(dateTime),
+		CameraMake:       info.Make,
+		CameraModel:      info.Model,
+		ISO:              info.ISO,
+		OriginalBasename: NoExt(source.Filename),
+		Ext:              destExt,
+		MD5:              md5Digest,
+		SHA256:           sha256Digest,
+		Sequence:         int64(scanIndex) + 1,
+	}, nil
+}
+
+// timestampBase formats the tool's traditional "20060102_150405_NNN"
+// basename (date/time down to milliseconds).
+func timestampBase(dateTime time.Time) string {
+	return dateTime.Format("20060102_150405") + fmt.Sprintf("_%03d", int64(time.Duration(dateTime.Nanosecond())/time.Millisecond))
+}
+
+// renderTemplate evaluates tmplText against data, returning the resulting
+// path (which may include '/' separators for subdirectories).
+func renderTemplate(tmplText string, data TemplateData) (string, error) {
+	tmpl, err := template.New("jpeg-renamer").Parse(tmplText)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import "time"
+
+// resolveSourceTimestamp determines the local (camera-zone) and UTC instant
+// for source: a sidecar's timestamp if one is ingested, else MediaTimestamp
+// (falling back to the file's mtime under -modtime), localized per -tz.
+// It's called from buildPlan, the single place that resolves timestamps for
+// both -dry-run reporting and a real run's own ApplyPlan, so the two can't
+// disagree.
+func resolveSourceTimestamp(source *Source, o *options) (local, utc time.Time, err error) {
+	path := source.Path
+
+	var dateTime time.Time
+	if t, ok := ingestSidecarTimestamp(path); ok {
+		// A sidecar's timestamp (written by a prior run, or corrected by
+		// exiftool) takes precedence over EXIF.
+		dateTime = t
+	} else {
+		dateTime, err = MediaTimestamp(path)
+		if err != nil {
+			if o.useModTime && err == errNoMediaTimestamp {
+				dateTime = source.File.ModTime()
+				err = nil
+			} else {
+				return
+			}
+		}
+	}
+
+	local, utc, tzErr := localizeTimestamp(path, dateTime, o.tz)
+	if tzErr != nil {
+		// Non-fatal: keep the un-localized wall clock rather than failing
+		// the whole file over an unresolvable zone.
+		local, utc = dateTime, dateTime
+	}
+
+	return
+}
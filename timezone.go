@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dsoprea/go-exif"
+)
+
+// TimezoneResolver maps a GPS coordinate (and the instant it was recorded)
+// to the IANA zone in effect there. jpeg-renamer doesn't bundle a
+// tz-shapefile database itself; callers who need GPS-based zone resolution
+// can wire one in (e.g. backed by github.com/ringsaturn/tzf or a vendored
+// tzdata shapefile) via SetTimezoneResolver. Without one, -tz=auto still
+// works whenever the file carries an EXIF OffsetTimeOriginal/OffsetTime tag
+// directly.
+type TimezoneResolver interface {
+	Resolve(lat, lon float64, at time.Time) (*time.Location, error)
+}
+
+var timezoneResolver TimezoneResolver
+
+// SetTimezoneResolver installs the resolver used by -tz=auto's GPS
+// fallback. Passing nil (the default) disables the GPS fallback; EXIF
+// offset tags are still honored.
+func SetTimezoneResolver(r TimezoneResolver) {
+	timezoneResolver = r
+}
+
+// localizeTimestamp reinterprets naive (a wall-clock time parsed with no
+// notion of zone) in whatever zone tzFlag selects, and returns both that
+// local time and the corresponding UTC instant.
+//
+//   - tzFlag == "": no reinterpretation; local and utc both equal naive, the
+//     tool's historical behavior.
+//   - tzFlag == "auto": prefer the file's EXIF OffsetTimeOriginal/OffsetTime
+//     tag; failing that, resolve the GPSInfo IFD's coordinates via the
+//     registered TimezoneResolver, if any.
+//   - otherwise: tzFlag is taken as an IANA zone name (e.g.
+//     "America/New_York").
+func localizeTimestamp(path string, naive time.Time, tzFlag string) (local, utc time.Time, err error) {
+	switch tzFlag {
+	case "":
+		return naive, naive, nil
+	case "auto":
+		local, utc = autoLocalizeTimestamp(path, naive)
+		return local, utc, nil
+	default:
+		loc, err := time.LoadLocation(tzFlag)
+		if err != nil {
+			return naive, naive, err
+		}
+		local = reinterpretInLocation(naive, loc)
+		return local, local.UTC(), nil
+	}
+}
+
+// reinterpretInLocation keeps t's wall-clock fields (year/month/.../nsec)
+// but attaches loc as its zone, changing which UTC instant it denotes.
+func reinterpretInLocation(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+// autoLocalizeTimestamp implements -tz=auto's fallback chain: EXIF offset
+// tag, then GPS-resolved zone, then (if neither is available) leave naive
+// as-is.
+func autoLocalizeTimestamp(path string, naive time.Time) (local, utc time.Time) {
+	if offset, ok := exifOffsetTag(path); ok {
+		if loc, ok := fixedZoneFromOffset(offset); ok {
+			local = reinterpretInLocation(naive, loc)
+			return local, local.UTC()
+		}
+	}
+
+	if timezoneResolver != nil {
+		if lat, lon, ok := gpsCoordinates(path); ok {
+			if loc, err := timezoneResolver.Resolve(lat, lon, naive); err == nil {
+				local = reinterpretInLocation(naive, loc)
+				return local, local.UTC()
+			}
+		}
+	}
+
+	return naive, naive
+}
+
+// exifOffsetTag reads OffsetTimeOriginal, falling back to OffsetTime, from
+// path's EXIF "Exif" IFD (e.g. "+09:00").
+func exifOffsetTag(path string) (string, bool) {
+	rawExif, err := exifRawBytesForTags(path)
+	if err != nil {
+		return "", false
+	}
+
+	index, err := exifIndexFromRawBytes(rawExif)
+	if err != nil {
+		return "", false
+	}
+
+	if v, ok := exifTagString(index, "IFD/Exif", "OffsetTimeOriginal"); ok {
+		return v, true
+	}
+	if v, ok := exifTagString(index, "IFD/Exif", "OffsetTime"); ok {
+		return v, true
+	}
+	return "", false
+}
+
+// fixedZoneFromOffset parses an EXIF-style "+09:00"/"-05:30" offset into a
+// fixed time.Location.
+func fixedZoneFromOffset(offset string) (*time.Location, bool) {
+	offset = strings.TrimSpace(offset)
+	if len(offset) != 6 || (offset[0] != '+' && offset[0] != '-') || offset[3] != ':' {
+		return nil, false
+	}
+
+	hours, err := strconv.Atoi(offset[1:3])
+	if err != nil {
+		return nil, false
+	}
+	minutes, err := strconv.Atoi(offset[4:6])
+	if err != nil {
+		return nil, false
+	}
+
+	seconds := hours*3600 + minutes*60
+	if offset[0] == '-' {
+		seconds = -seconds
+	}
+
+	return time.FixedZone(fmt.Sprintf("UTC%s", offset), seconds), true
+}
+
+// gpsCoordinates reads GPSLatitude/GPSLongitude (plus their N/S, E/W
+// reference tags) from path's GPSInfo IFD, as decimal degrees.
+func gpsCoordinates(path string) (lat, lon float64, ok bool) {
+	rawExif, err := exifRawBytesForTags(path)
+	if err != nil {
+		return
+	}
+
+	index, err := exifIndexFromRawBytes(rawExif)
+	if err != nil {
+		return
+	}
+
+	gpsIfd, err := index.RootIfd.ChildWithIfdPath("IFD/GPSInfo")
+	if err != nil {
+		return
+	}
+
+	latVal, latOk := gpsDMSTagValue(index, gpsIfd, "GPSLatitude")
+	lonVal, lonOk := gpsDMSTagValue(index, gpsIfd, "GPSLongitude")
+	if !latOk || !lonOk {
+		return
+	}
+
+	latRef, _ := exifTagString(index, "IFD/GPSInfo", "GPSLatitudeRef")
+	lonRef, _ := exifTagString(index, "IFD/GPSInfo", "GPSLongitudeRef")
+
+	if strings.EqualFold(latRef, "S") {
+		latVal = -latVal
+	}
+	if strings.EqualFold(lonRef, "W") {
+		lonVal = -lonVal
+	}
+
+	return latVal, lonVal, true
+}
+
+func gpsDMSTagValue(index exif.IfdIndex, ifd *exif.Ifd, tagName string) (float64, bool) {
+	results, err := ifd.FindTagWithName(tagName)
+	if err != nil || len(results) == 0 {
+		return 0, false
+	}
+
+	value, err := index.RootIfd.TagValue(results[0])
+	if err != nil {
+		return 0, false
+	}
+
+	return dmsToDecimal(value)
+}
+
+// dmsToDecimal converts a [degrees, minutes, seconds] slice of EXIF
+// rationals into decimal degrees. Reflection is used here rather than a
+// concrete rational type because the exact struct go-exif represents a
+// rational value with has shifted across its module versions; field-name
+// lookup keeps this working across those.
+func dmsToDecimal(value interface{}) (float64, bool) {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice || rv.Len() < 3 {
+		return 0, false
+	}
+
+	degrees, ok := rationalToFloat(rv.Index(0).Interface())
+	if !ok {
+		return 0, false
+	}
+	minutes, ok := rationalToFloat(rv.Index(1).Interface())
+	if !ok {
+		return 0, false
+	}
+	seconds, ok := rationalToFloat(rv.Index(2).Interface())
+	if !ok {
+		return 0, false
+	}
+
+	return degrees + minutes/60 + seconds/3600, true
+}
+
+// rationalToFloat converts a struct with Numerator/Denominator fields
+// (whatever concrete type go-exif uses for EXIF RATIONAL values) to a
+// float64.
+func rationalToFloat(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Struct {
+		return 0, false
+	}
+
+	num := rv.FieldByName("Numerator")
+	den := rv.FieldByName("Denominator")
+	if !num.IsValid() || !den.IsValid() {
+		return 0, false
+	}
+
+	n := reflectNumberToFloat(num)
+	d := reflectNumberToFloat(den)
+	if d == 0 {
+		return 0, false
+	}
+
+	return n / d, true
+}
+
+func reflectNumberToFloat(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	default:
+		return 0
+	}
+}
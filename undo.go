@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// UndoEntry is one executed action, durable enough to reverse later.
+type UndoEntry struct {
+	Action string `json:"action"`
+	Src    string `json:"src"`
+	Dst    string `json:"dst"`
+}
+
+// UndoJournal appends UndoEntry records as they're executed, so a partial
+// or completed run always leaves a record of what changed. Safe for
+// concurrent use by the worker pool.
+type UndoJournal struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewUndoJournal creates (or truncates) the journal file at path.
+func NewUndoJournal(path string) (*UndoJournal, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &UndoJournal{file: f}, nil
+}
+
+// undoJournalPath returns the default `.jpeg-renamer-undo-<ts>.jsonl` path
+// for a journal started at startedAt, rooted at targetFolder.
+func undoJournalPath(targetFolder string, startedAt time.Time) string {
+	name := fmt.Sprintf(".jpeg-renamer-undo-%s.jsonl", startedAt.Format("20060102_150405"))
+	return filepath.Join(targetFolder, name)
+}
+
+// Record appends one executed action to the journal.
+func (j *UndoJournal) Record(action, src, dst string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	line, err := json.Marshal(UndoEntry{Action: action, Src: src, Dst: dst})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	_, err = j.file.Write(line)
+	return err
+}
+
+// Close closes the underlying journal file.
+func (j *UndoJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.file.Close()
+}
+
+// RunUndo reverses every action recorded in the journal at path, most
+// recently executed first.
+func RunUndo(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var entries []UndoEntry
+	scanner := bufio.NewScanner(f)
+	// Journal lines can carry long template-rendered paths.
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var entry UndoEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return fmt.Errorf("malformed undo journal line %q: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		if err := undoOne(entries[i]); err != nil {
+			fmt.Fprintf(os.Stderr, "undo \"%s\" -> \"%s\": %v\n", entries[i].Src, entries[i].Dst, err)
+			continue
+		}
+		fmt.Printf("undo %s \"%s\" -> \"%s\"\n", entries[i].Action, entries[i].Dst, entries[i].Src)
+	}
+
+	return nil
+}
+
+// undoOne reverses a single recorded action.
+func undoOne(entry UndoEntry) error {
+	switch entry.Action {
+	case "mv":
+		return os.Rename(entry.Dst, entry.Src)
+	case "cp", "symlink", "hardlink", "dedupe":
+		// The source file is untouched by these actions; undoing just
+		// means removing what was created at the destination. For
+		// "dedupe" this only removes the date-named link, not the
+		// content-store blob, since other links may still reference it.
+		return os.Remove(entry.Dst)
+	default:
+		return fmt.Errorf("unknown action %q", entry.Action)
+	}
+}